@@ -0,0 +1,228 @@
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Tokenizer is the host-side tokenizer implementation shared across all
+// embedding plugins over the broker, instead of each plugin shipping its
+// own tokenizer.
+type Tokenizer interface {
+	CountTokens(ctx context.Context, text string) (int, error)
+	Encode(ctx context.Context, text string) ([]int32, error)
+}
+
+// VectorCacheStore is the host-side vector cache implementation shared
+// across all embedding plugins over the broker.
+type VectorCacheStore interface {
+	Get(ctx context.Context, key string) (embedding []float32, found bool, err error)
+	Put(ctx context.Context, key string, embedding []float32) error
+}
+
+// HostServices bundles the callback services a host offers plugins over
+// the GRPCBroker. Either field may be left nil to not offer that
+// service.
+type HostServices struct {
+	Tokenizer   Tokenizer
+	VectorCache VectorCacheStore
+}
+
+type hostServiceClientsKey struct{}
+
+// hostServiceClients bundles the clients an Embedding implementation
+// retrieves from its context to reach the host's TokenizerService and
+// VectorCache.
+type hostServiceClients struct {
+	Tokenizer   TokenizerServiceClient
+	VectorCache VectorCacheClient
+}
+
+// HostServiceClientsFromContext returns the clients dialed back to the
+// host over the broker for the request currently being handled, or ok ==
+// false if the request carried no broker_id.
+func HostServiceClientsFromContext(ctx context.Context) (tokenizer TokenizerServiceClient, vectorCache VectorCacheClient, ok bool) {
+	clients, ok := ctx.Value(hostServiceClientsKey{}).(hostServiceClients)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return clients.Tokenizer, clients.VectorCache, true
+}
+
+// hostServiceConnCache keeps the first successful dial of each broker ID
+// and reuses its clients for every later call, so a long-running plugin
+// process handling many requests over the same broker connection doesn't
+// leak one grpc.ClientConn per RPC. Each broker ID gets its own
+// hostServiceConnEntry so a slow dial for one ID can't stall calls already
+// routed to another, already-cached ID.
+type hostServiceConnCache struct {
+	// dial is DialHostServices unless overridden by tests.
+	dial func(broker *plugin.GRPCBroker, brokerID uint32) (TokenizerServiceClient, VectorCacheClient, error)
+
+	mu      sync.Mutex
+	entries map[uint32]*hostServiceConnEntry
+}
+
+// hostServiceConnEntry lazily dials the host services for one broker ID.
+// Its sync.Once ensures the dial runs at most once per entry without
+// holding hostServiceConnCache.mu for the duration of the call; an entry
+// whose dial failed is evicted, so a later call for the ID dials again.
+type hostServiceConnEntry struct {
+	once    sync.Once
+	clients hostServiceClients
+	err     error
+}
+
+func (c *hostServiceConnCache) get(broker *plugin.GRPCBroker, brokerID uint32) (hostServiceClients, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[brokerID]
+	if !ok {
+		entry = &hostServiceConnEntry{}
+
+		if c.entries == nil {
+			c.entries = make(map[uint32]*hostServiceConnEntry)
+		}
+		c.entries[brokerID] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		dial := c.dial
+		if dial == nil {
+			dial = DialHostServices
+		}
+
+		tokenizer, vectorCache, err := dial(broker, brokerID)
+		if err != nil {
+			entry.err = err
+
+			return
+		}
+
+		entry.clients = hostServiceClients{
+			Tokenizer:   tokenizer,
+			VectorCache: vectorCache,
+		}
+	})
+
+	if entry.err != nil {
+		// Don't let a transient dial failure poison this broker ID for
+		// the rest of the process's lifetime: evict the failed entry so
+		// the next call gets a fresh hostServiceConnEntry and retries.
+		c.mu.Lock()
+		if c.entries[brokerID] == entry {
+			delete(c.entries, brokerID)
+		}
+		c.mu.Unlock()
+	}
+
+	return entry.clients, entry.err
+}
+
+// ServeHostServices starts a gRPC server exposing TokenizerService and
+// VectorCache on a new broker connection and registers it with broker so
+// a plugin can dial back into it. The returned ID should be set on the
+// broker_id field of requests sent to the plugin.
+func ServeHostServices(broker *plugin.GRPCBroker, services HostServices) uint32 {
+	id := broker.NextId()
+
+	go broker.AcceptAndServe(id, func(opts []grpc.ServerOption) *grpc.Server {
+		srv := grpc.NewServer(opts...)
+
+		if services.Tokenizer != nil {
+			RegisterTokenizerServiceServer(srv, &tokenizerGRPCServer{Impl: services.Tokenizer})
+		}
+
+		if services.VectorCache != nil {
+			RegisterVectorCacheServer(srv, &vectorCacheGRPCServer{Impl: services.VectorCache})
+		}
+
+		return srv
+	})
+
+	return id
+}
+
+// DialHostServices dials the host's broker connection for brokerID and
+// returns clients for the services it offers. Plugin authors call this
+// with the broker_id carried on the request they are handling instead of
+// shipping their own tokenizer or cache.
+func DialHostServices(broker *plugin.GRPCBroker, brokerID uint32) (TokenizerServiceClient, VectorCacheClient, error) {
+	conn, err := broker.Dial(brokerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dialing host services: %w", err)
+	}
+
+	return NewTokenizerServiceClient(conn), NewVectorCacheClient(conn), nil
+}
+
+// tokenizerGRPCServer is the gRPC server side of a host's Tokenizer,
+// served to plugins over the broker.
+type tokenizerGRPCServer struct {
+	UnimplementedTokenizerServiceServer
+
+	Impl Tokenizer
+}
+
+var _ TokenizerServiceServer = (*tokenizerGRPCServer)(nil)
+
+func (s *tokenizerGRPCServer) CountTokens(
+	ctx context.Context,
+	req *CountTokensRequest,
+) (*CountTokensResponse, error) {
+	count, err := s.Impl.CountTokens(ctx, req.Text)
+	if err != nil {
+		return nil, fmt.Errorf("count tokens failed: %w", err)
+	}
+
+	return &CountTokensResponse{Count: int32(count)}, nil
+}
+
+func (s *tokenizerGRPCServer) Encode(ctx context.Context, req *EncodeRequest) (*EncodeResponse, error) {
+	tokens, err := s.Impl.Encode(ctx, req.Text)
+	if err != nil {
+		return nil, fmt.Errorf("encode failed: %w", err)
+	}
+
+	return &EncodeResponse{Tokens: tokens}, nil
+}
+
+// vectorCacheGRPCServer is the gRPC server side of a host's
+// VectorCacheStore, served to plugins over the broker.
+type vectorCacheGRPCServer struct {
+	UnimplementedVectorCacheServer
+
+	Impl VectorCacheStore
+}
+
+var _ VectorCacheServer = (*vectorCacheGRPCServer)(nil)
+
+func (s *vectorCacheGRPCServer) Get(
+	ctx context.Context,
+	req *VectorCacheGetRequest,
+) (*VectorCacheGetResponse, error) {
+	embedding, found, err := s.Impl.Get(ctx, req.Key)
+	if err != nil {
+		return nil, fmt.Errorf("vector cache get failed: %w", err)
+	}
+
+	return &VectorCacheGetResponse{Found: found, Embedding: embedding}, nil
+}
+
+func (s *vectorCacheGRPCServer) Put(
+	ctx context.Context,
+	req *VectorCachePutRequest,
+) (*VectorCachePutResponse, error) {
+	if err := s.Impl.Put(ctx, req.Key, req.Embedding); err != nil {
+		return nil, fmt.Errorf("vector cache put failed: %w", err)
+	}
+
+	return &VectorCachePutResponse{}, nil
+}
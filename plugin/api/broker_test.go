@@ -0,0 +1,114 @@
+//
+
+package api
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+func TestHostServiceConnCacheCachesDials(t *testing.T) {
+	var calls int32
+
+	cache := &hostServiceConnCache{
+		dial: func(*plugin.GRPCBroker, uint32) (TokenizerServiceClient, VectorCacheClient, error) {
+			atomic.AddInt32(&calls, 1)
+
+			return nil, nil, nil
+		},
+	}
+
+	if _, err := cache.get(nil, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := cache.get(nil, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("dial called %d times, want 1", got)
+	}
+}
+
+func TestHostServiceConnCacheRetriesAfterDialFailure(t *testing.T) {
+	wantErr := errors.New("transient")
+
+	var calls int32
+	cache := &hostServiceConnCache{
+		dial: func(*plugin.GRPCBroker, uint32) (TokenizerServiceClient, VectorCacheClient, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil, nil, wantErr
+			}
+
+			return nil, nil, nil
+		},
+	}
+
+	if _, err := cache.get(nil, 1); !errors.Is(err, wantErr) {
+		t.Fatalf("first call: got error %v, want it to wrap %v", err, wantErr)
+	}
+
+	if _, err := cache.get(nil, 1); err != nil {
+		t.Fatalf("second call: unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("dial called %d times, want 2 (one failure, one retry)", got)
+	}
+}
+
+func TestHostServiceConnCacheDoesNotSerializeAcrossBrokerIDs(t *testing.T) {
+	slowStarted := make(chan struct{})
+	release := make(chan struct{})
+
+	cache := &hostServiceConnCache{
+		dial: func(_ *plugin.GRPCBroker, brokerID uint32) (TokenizerServiceClient, VectorCacheClient, error) {
+			if brokerID == 1 {
+				close(slowStarted)
+				<-release
+			}
+
+			return nil, nil, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if _, err := cache.get(nil, 1); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-slowStarted:
+	case <-time.After(time.Second):
+		t.Fatal("slow dial never started")
+	}
+
+	fastDone := make(chan struct{})
+	go func() {
+		if _, err := cache.get(nil, 2); err != nil {
+			t.Error(err)
+		}
+
+		close(fastDone)
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Fatal("dial for a second broker ID blocked behind the slow dial for the first")
+	}
+
+	close(release)
+	wg.Wait()
+}
@@ -5,7 +5,9 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/rpc"
+	"strconv"
 
 	"github.com/hashicorp/go-plugin"
 	"google.golang.org/grpc"
@@ -18,12 +20,129 @@ type Embedding interface {
 	Embedding(ctx context.Context, input string) ([]float32, error)
 }
 
+// BatchEmbedder is an optional capability an Embedding implementation may
+// provide to embed a batch of inputs in a single round-trip, e.g. by
+// calling a batched upstream API. Implementations that don't provide it
+// get EmbeddingGRPCServer's fallback, which loops over Embedding.
+type BatchEmbedder interface {
+	// EmbeddingBatch returns one embedding per input.
+	EmbeddingBatch(ctx context.Context, input []string) ([][]float32, error)
+}
+
+// StreamEmbedder is an optional capability an Embedding implementation
+// may provide to emit vectors as they are produced rather than buffering
+// a whole batch, and to split long inputs into chunks of at most
+// chunkTokens tokens. Implementations that don't provide it get
+// EmbeddingGRPCServer's fallback, which loops over Embedding and ignores
+// chunkTokens.
+type StreamEmbedder interface {
+	// EmbeddingStream invokes fn with each vector as it becomes
+	// available. Implementations should stop and return fn's error as
+	// soon as it is non-nil.
+	EmbeddingStream(ctx context.Context, input []string, chunkTokens int, fn func(EmbeddingChunk) error) error
+}
+
+// embeddingBatch returns one embedding per input, using impl's
+// BatchEmbedder implementation if it has one, or else looping over
+// Embedding.
+func embeddingBatch(ctx context.Context, impl Embedding, input []string) ([][]float32, error) {
+	if batcher, ok := impl.(BatchEmbedder); ok {
+		return batcher.EmbeddingBatch(ctx, input)
+	}
+
+	embeddings := make([][]float32, len(input))
+	for i, in := range input {
+		embedding, err := impl.Embedding(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+
+		embeddings[i] = embedding
+	}
+
+	return embeddings, nil
+}
+
+// embeddingStream invokes fn with one vector per input, using impl's
+// StreamEmbedder implementation if it has one, or else looping over
+// Embedding and ignoring chunkTokens.
+func embeddingStream(
+	ctx context.Context,
+	impl Embedding,
+	input []string,
+	chunkTokens int,
+	fn func(EmbeddingChunk) error,
+) error {
+	if streamer, ok := impl.(StreamEmbedder); ok {
+		return streamer.EmbeddingStream(ctx, input, chunkTokens, fn)
+	}
+
+	for i, in := range input {
+		embedding, err := impl.Embedding(ctx, in)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(EmbeddingChunk{Index: i, Embedding: embedding}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EmbeddingChunk is a single vector produced by EmbeddingStream, along with
+// the index of the input it was computed from and, when chunk_tokens splitting
+// was requested, the token range of the source text it covers.
+type EmbeddingChunk struct {
+	// Index is the position within the input slice passed to
+	// EmbeddingStream that produced this chunk.
+	Index int
+
+	// Embedding is the vector for this chunk.
+	Embedding []float32
+
+	// TokenOffset is the starting token offset of this chunk within its
+	// source input. It is always 0 when chunking was not requested.
+	TokenOffset int
+
+	// TokenCount is the number of tokens covered by this chunk.
+	TokenCount int
+}
+
 // EmbeddingPlugin is the implementation of the plugin for the embedding
 // plugin.
 type EmbeddingPlugin struct {
 	plugin.Plugin
 
 	Embedding Embedding
+
+	// Multiplexing, when true, lets this single plugin process serve
+	// many logical Embedding instances distinguished by a multiplex ID
+	// carried in gRPC metadata, instead of the host spawning one
+	// subprocess per instance. Factory must be set when Multiplexing is
+	// true; Embedding is ignored.
+	Multiplexing bool
+
+	// Factory constructs a new Embedding instance on demand for a given
+	// multiplex ID. Only used when Multiplexing is true.
+	Factory EmbeddingFactory
+
+	// Version, if set, answers the PluginVersion.Version call the host
+	// makes right after handshake to negotiate capabilities. Plugins
+	// that leave it nil report no semver and no capabilities.
+	Version VersionProvider
+
+	// Readiness, if set, gates the plugin's health status: the standard
+	// gRPC health service reports NOT_SERVING until it returns nil, and
+	// SERVING after. Plugins that leave it nil report SERVING as soon
+	// as GRPCServer returns.
+	Readiness Readiness
+
+	// HostServices, set on the host side, are callback services made
+	// available to the plugin over the GRPCBroker so it can defer
+	// tokenization and caching to the host instead of shipping its own.
+	HostServices HostServices
 }
 
 var (
@@ -49,19 +168,40 @@ func (plugin *EmbeddingPlugin) Client(_ *plugin.MuxBroker, _ *rpc.Client) (inter
 }
 
 // GRPCServer registers the embedding plugin with the gRPC server.
-func (plugin *EmbeddingPlugin) GRPCServer(_ *plugin.GRPCBroker, srv *grpc.Server) error {
-	RegisterEmbeddingServer(srv, NewEmbeddingGRPCServer(plugin.Embedding))
+func (plugin *EmbeddingPlugin) GRPCServer(broker *plugin.GRPCBroker, srv *grpc.Server) error {
+	registerHealth(srv, plugin.Readiness)
+	RegisterPluginVersionServer(srv, NewPluginVersionGRPCServer(plugin.Version))
+
+	if plugin.Multiplexing {
+		multiplexSrv := NewEmbeddingMultiplexGRPCServer(plugin.Factory)
+		multiplexSrv.Broker = broker
+		RegisterEmbeddingServer(srv, multiplexSrv)
+
+		return nil
+	}
+
+	embeddingSrv := NewEmbeddingGRPCServer(plugin.Embedding)
+	embeddingSrv.Broker = broker
+	RegisterEmbeddingServer(srv, embeddingSrv)
 
 	return nil
 }
 
-// GRPCClient returns the embedding plugin client.
+// GRPCClient returns the embedding plugin client. If HostServices are
+// configured, it also serves them on a new broker connection so the
+// plugin can dial back into the host.
 func (plugin *EmbeddingPlugin) GRPCClient(
 	_ context.Context,
-	_ *plugin.GRPCBroker,
+	broker *plugin.GRPCBroker,
 	client *grpc.ClientConn,
 ) (interface{}, error) {
-	return NewEmbeddingGRPCClient(NewEmbeddingClient(client)), nil
+	grpcClient := NewEmbeddingGRPCClient(NewEmbeddingClient(client))
+
+	if plugin.HostServices.Tokenizer != nil || plugin.HostServices.VectorCache != nil {
+		grpcClient.BrokerID = ServeHostServices(broker, plugin.HostServices)
+	}
+
+	return grpcClient, nil
 }
 
 // EmbeddingGRPCServer is the gRPC server implementation of the plugin.
@@ -69,6 +209,30 @@ type EmbeddingGRPCServer struct {
 	UnimplementedEmbeddingServer
 
 	Impl Embedding
+
+	// Broker, if set, is used to dial back into the host's
+	// TokenizerService and VectorCache when a request carries a
+	// non-zero broker_id.
+	Broker *plugin.GRPCBroker
+
+	hostServiceConns hostServiceConnCache
+}
+
+// withHostServiceClients dials (or reuses a cached dial of) the host's
+// broker connection for brokerID, if non-zero, and returns a context an
+// Embedding implementation can retrieve the resulting clients from via
+// HostServiceClientsFromContext.
+func (s *EmbeddingGRPCServer) withHostServiceClients(ctx context.Context, brokerID uint32) (context.Context, error) {
+	if s.Broker == nil || brokerID == 0 {
+		return ctx, nil
+	}
+
+	clients, err := s.hostServiceConns.get(s.Broker, brokerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return context.WithValue(ctx, hostServiceClientsKey{}, clients), nil
 }
 
 var _ EmbeddingServer = (*EmbeddingGRPCServer)(nil)
@@ -87,6 +251,11 @@ func (s *EmbeddingGRPCServer) Embedding(
 ) (*EmbeddingResponse, error) {
 	ctx = InitLogging(ctx, "embedding")
 
+	ctx, err := s.withHostServiceClients(ctx, req.BrokerId)
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+
 	embedding, err := s.Impl.Embedding(ctx, req.Input)
 	if err != nil {
 		return nil, fmt.Errorf("embedding failed: %w", err)
@@ -97,12 +266,91 @@ func (s *EmbeddingGRPCServer) Embedding(
 	}, nil
 }
 
+// EmbeddingBatch implements the gRPC server for the batch embedding call.
+func (s *EmbeddingGRPCServer) EmbeddingBatch(
+	ctx context.Context,
+	req *EmbeddingBatchRequest,
+) (*EmbeddingBatchResponse, error) {
+	ctx = InitLogging(ctx, "embedding_batch")
+
+	ctx, err := s.withHostServiceClients(ctx, req.BrokerId)
+	if err != nil {
+		return nil, fmt.Errorf("embedding batch failed: %w", err)
+	}
+
+	input := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		input[i] = item.Input
+	}
+
+	embeddings, err := embeddingBatch(ctx, s.Impl, input)
+	if err != nil {
+		return nil, fmt.Errorf("embedding batch failed: %w", err)
+	}
+
+	vectors := make([]*EmbeddingVector, len(embeddings))
+	for i, embedding := range embeddings {
+		vectors[i] = &EmbeddingVector{
+			Id:        req.Items[i].Id,
+			Embedding: embedding,
+		}
+	}
+
+	return &EmbeddingBatchResponse{
+		Vectors: vectors,
+	}, nil
+}
+
+// EmbeddingStream implements the gRPC server for the streaming embedding
+// call, forwarding each chunk to the client as soon as the plugin produces
+// it.
+func (s *EmbeddingGRPCServer) EmbeddingStream(
+	req *EmbeddingBatchRequest,
+	stream Embedding_EmbeddingStreamServer,
+) error {
+	ctx := InitLogging(stream.Context(), "embedding_stream")
+
+	ctx, err := s.withHostServiceClients(ctx, req.BrokerId)
+	if err != nil {
+		return fmt.Errorf("embedding stream failed: %w", err)
+	}
+
+	input := make([]string, len(req.Items))
+	for i, item := range req.Items {
+		input[i] = item.Input
+	}
+
+	err = embeddingStream(ctx, s.Impl, input, int(req.ChunkTokens), func(chunk EmbeddingChunk) error {
+		return stream.Send(&EmbeddingVector{
+			Id:          req.Items[chunk.Index].Id,
+			Embedding:   chunk.Embedding,
+			TokenOffset: int32(chunk.TokenOffset),
+			TokenCount:  int32(chunk.TokenCount),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("embedding stream failed: %w", err)
+	}
+
+	return nil
+}
+
 // EmbeddingGRPCClient is the gRPC client implementation of the plugin.
 type EmbeddingGRPCClient struct {
 	Client EmbeddingClient
+
+	// BrokerID, when non-zero, is the GRPCBroker connection ID the
+	// plugin can dial to reach the host's TokenizerService and
+	// VectorCache. Set by EmbeddingPlugin.GRPCClient when HostServices
+	// are configured.
+	BrokerID uint32
 }
 
-var _ Embedding = (*EmbeddingGRPCClient)(nil)
+var (
+	_ Embedding      = (*EmbeddingGRPCClient)(nil)
+	_ BatchEmbedder  = (*EmbeddingGRPCClient)(nil)
+	_ StreamEmbedder = (*EmbeddingGRPCClient)(nil)
+)
 
 // NewEmbeddingGRPCClient returns a new EmbeddingGRPCClient.
 func NewEmbeddingGRPCClient(client EmbeddingClient) *EmbeddingGRPCClient {
@@ -117,7 +365,8 @@ func (c *EmbeddingGRPCClient) Embedding(
 	input string,
 ) ([]float32, error) {
 	req := &EmbeddingRequest{
-		Input: input,
+		Input:    input,
+		BrokerId: c.BrokerID,
 	}
 
 	resp, err := c.Client.Embedding(ctx, req)
@@ -127,3 +376,84 @@ func (c *EmbeddingGRPCClient) Embedding(
 
 	return resp.Embedding, nil
 }
+
+// EmbeddingBatch implements the gRPC client for the batch embedding call.
+func (c *EmbeddingGRPCClient) EmbeddingBatch(
+	ctx context.Context,
+	input []string,
+) ([][]float32, error) {
+	req := &EmbeddingBatchRequest{
+		Items:    make([]*EmbeddingItem, len(input)),
+		BrokerId: c.BrokerID,
+	}
+	indexByID := make(map[string]int, len(input))
+	for i, in := range input {
+		id := strconv.Itoa(i)
+		req.Items[i] = &EmbeddingItem{
+			Id:    id,
+			Input: in,
+		}
+		indexByID[id] = i
+	}
+
+	resp, err := c.Client.EmbeddingBatch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding batch failed: %w", err)
+	}
+
+	embeddings := make([][]float32, len(resp.Vectors))
+	for _, vector := range resp.Vectors {
+		embeddings[indexByID[vector.Id]] = vector.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// EmbeddingStream implements the gRPC client for the streaming embedding
+// call.
+func (c *EmbeddingGRPCClient) EmbeddingStream(
+	ctx context.Context,
+	input []string,
+	chunkTokens int,
+	fn func(EmbeddingChunk) error,
+) error {
+	req := &EmbeddingBatchRequest{
+		Items:       make([]*EmbeddingItem, len(input)),
+		ChunkTokens: int32(chunkTokens),
+		BrokerId:    c.BrokerID,
+	}
+	indexByID := make(map[string]int, len(input))
+	for i, in := range input {
+		id := strconv.Itoa(i)
+		req.Items[i] = &EmbeddingItem{
+			Id:    id,
+			Input: in,
+		}
+		indexByID[id] = i
+	}
+
+	stream, err := c.Client.EmbeddingStream(ctx, req)
+	if err != nil {
+		return fmt.Errorf("embedding stream failed: %w", err)
+	}
+
+	for {
+		vector, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("embedding stream failed: %w", err)
+		}
+
+		err = fn(EmbeddingChunk{
+			Index:       indexByID[vector.Id],
+			Embedding:   vector.Embedding,
+			TokenOffset: int(vector.TokenOffset),
+			TokenCount:  int(vector.TokenCount),
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
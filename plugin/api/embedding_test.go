@@ -0,0 +1,195 @@
+//
+
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fakeEmbedding struct {
+	calls []string
+}
+
+func (f *fakeEmbedding) Embedding(_ context.Context, input string) ([]float32, error) {
+	f.calls = append(f.calls, input)
+
+	return []float32{float32(len(input))}, nil
+}
+
+type fakeBatchEmbedding struct {
+	fakeEmbedding
+
+	batchCalls [][]string
+}
+
+func (f *fakeBatchEmbedding) EmbeddingBatch(_ context.Context, input []string) ([][]float32, error) {
+	f.batchCalls = append(f.batchCalls, input)
+
+	embeddings := make([][]float32, len(input))
+	for i, in := range input {
+		embeddings[i] = []float32{float32(len(in))}
+	}
+
+	return embeddings, nil
+}
+
+type fakeStreamEmbedding struct {
+	fakeEmbedding
+
+	streamCalls [][]string
+}
+
+func (f *fakeStreamEmbedding) EmbeddingStream(
+	_ context.Context,
+	input []string,
+	chunkTokens int,
+	fn func(EmbeddingChunk) error,
+) error {
+	f.streamCalls = append(f.streamCalls, input)
+
+	for i, in := range input {
+		err := fn(EmbeddingChunk{
+			Index:       i,
+			Embedding:   []float32{float32(len(in))},
+			TokenOffset: chunkTokens,
+			TokenCount:  len(in),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestEmbeddingBatchUsesBatchEmbedderWhenAvailable(t *testing.T) {
+	impl := &fakeBatchEmbedding{}
+
+	got, err := embeddingBatch(context.Background(), impl, []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := [][]float32{{1}, {2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if len(impl.batchCalls) != 1 {
+		t.Errorf("EmbeddingBatch called %d times, want 1", len(impl.batchCalls))
+	}
+
+	if len(impl.calls) != 0 {
+		t.Errorf("Embedding fallback called %d times, want 0", len(impl.calls))
+	}
+}
+
+func TestEmbeddingBatchFallsBackToEmbedding(t *testing.T) {
+	impl := &fakeEmbedding{}
+
+	got, err := embeddingBatch(context.Background(), impl, []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := [][]float32{{1}, {2}, {3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if !reflect.DeepEqual(impl.calls, []string{"a", "bb", "ccc"}) {
+		t.Errorf("Embedding called with %v, want inputs in order", impl.calls)
+	}
+}
+
+func TestEmbeddingBatchFallbackPropagatesError(t *testing.T) {
+	wantErr := errors.New("boom")
+	impl := &failingEmbedding{err: wantErr}
+
+	if _, err := embeddingBatch(context.Background(), impl, []string{"a"}); !errors.Is(err, wantErr) {
+		t.Fatalf("got error %v, want it to wrap %v", err, wantErr)
+	}
+}
+
+func TestEmbeddingStreamUsesStreamEmbedderWhenAvailable(t *testing.T) {
+	impl := &fakeStreamEmbedding{}
+
+	var got []EmbeddingChunk
+	err := embeddingStream(context.Background(), impl, []string{"a", "bb"}, 7, func(chunk EmbeddingChunk) error {
+		got = append(got, chunk)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []EmbeddingChunk{
+		{Index: 0, Embedding: []float32{1}, TokenOffset: 7, TokenCount: 1},
+		{Index: 1, Embedding: []float32{2}, TokenOffset: 7, TokenCount: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if len(impl.streamCalls) != 1 {
+		t.Errorf("EmbeddingStream called %d times, want 1", len(impl.streamCalls))
+	}
+
+	if len(impl.calls) != 0 {
+		t.Errorf("Embedding fallback called %d times, want 0", len(impl.calls))
+	}
+}
+
+func TestEmbeddingStreamFallsBackToEmbeddingAndIgnoresChunkTokens(t *testing.T) {
+	impl := &fakeEmbedding{}
+
+	var got []EmbeddingChunk
+	err := embeddingStream(context.Background(), impl, []string{"a", "bb"}, 7, func(chunk EmbeddingChunk) error {
+		got = append(got, chunk)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []EmbeddingChunk{
+		{Index: 0, Embedding: []float32{1}},
+		{Index: 1, Embedding: []float32{2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEmbeddingStreamFallbackStopsOnFnError(t *testing.T) {
+	impl := &fakeEmbedding{}
+	wantErr := errors.New("stop")
+
+	calls := 0
+	err := embeddingStream(context.Background(), impl, []string{"a", "bb", "ccc"}, 0, func(EmbeddingChunk) error {
+		calls++
+
+		return wantErr
+	})
+
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("got error %v, want it to wrap %v", err, wantErr)
+	}
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1 (stop after first error)", calls)
+	}
+}
+
+type failingEmbedding struct {
+	err error
+}
+
+func (f *failingEmbedding) Embedding(context.Context, string) ([]float32, error) {
+	return nil, f.err
+}
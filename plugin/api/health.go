@@ -0,0 +1,79 @@
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthServiceName is the gRPC health service name go-plugin clients
+// check to learn whether a plugin process is ready to serve, per the
+// go-plugin convention.
+const healthServiceName = "plugin"
+
+// Readiness is called once per plugin process to determine when it has
+// finished whatever startup work it needs (loading model weights,
+// warming a GPU, ...). The health service reports NOT_SERVING until it
+// returns nil, after which it reports SERVING.
+type Readiness func(ctx context.Context) error
+
+// registerHealth wires the standard grpc_health_v1 health service into
+// srv, running readiness in the background and flipping the reported
+// status to SERVING once it completes without error. A nil readiness
+// reports SERVING immediately.
+func registerHealth(srv *grpc.Server, readiness Readiness) *health.Server {
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, healthSrv)
+
+	if readiness == nil {
+		healthSrv.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_SERVING)
+
+		return healthSrv
+	}
+
+	go func() {
+		if err := readiness(context.Background()); err != nil {
+			healthSrv.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+			return
+		}
+
+		healthSrv.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_SERVING)
+	}()
+
+	return healthSrv
+}
+
+// WaitForReady watches the standard gRPC health service over conn until it
+// reports SERVING, ctx is done, or timeout elapses. Hosts should call
+// this before dispensing a plugin so embedding RPCs issued during model
+// load backpressure cleanly instead of timing out.
+func WaitForReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := healthpb.NewHealthClient(conn)
+
+	watch, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: healthServiceName})
+	if err != nil {
+		return fmt.Errorf("health watch failed: %w", err)
+	}
+
+	for {
+		resp, err := watch.Recv()
+		if err != nil {
+			return fmt.Errorf("health watch failed: %w", err)
+		}
+
+		if resp.Status == healthpb.HealthCheckResponse_SERVING {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+//
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func checkHealth(t *testing.T, healthSrv healthpb.HealthServer) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	resp, err := healthSrv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: healthServiceName})
+	if err != nil {
+		t.Fatalf("health check failed: %v", err)
+	}
+
+	return resp.Status
+}
+
+func TestRegisterHealthNilReadinessServesImmediately(t *testing.T) {
+	healthSrv := registerHealth(grpc.NewServer(), nil)
+
+	if got := checkHealth(t, healthSrv); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("got status %v, want SERVING", got)
+	}
+}
+
+func TestRegisterHealthNotServingUntilReadinessCompletes(t *testing.T) {
+	release := make(chan struct{})
+	healthSrv := registerHealth(grpc.NewServer(), func(context.Context) error {
+		<-release
+
+		return nil
+	})
+
+	if got := checkHealth(t, healthSrv); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("got status %v before readiness completed, want NOT_SERVING", got)
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if checkHealth(t, healthSrv) == healthpb.HealthCheckResponse_SERVING {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("status never flipped to SERVING after readiness completed")
+}
+
+func TestRegisterHealthStaysNotServingOnReadinessError(t *testing.T) {
+	ran := make(chan struct{})
+	healthSrv := registerHealth(grpc.NewServer(), func(context.Context) error {
+		defer close(ran)
+
+		return errors.New("not ready")
+	})
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("readiness was never invoked")
+	}
+
+	if got := checkHealth(t, healthSrv); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got status %v after readiness failed, want NOT_SERVING", got)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer lis.Close()
+
+	srv := grpc.NewServer()
+	release := make(chan struct{})
+	registerHealth(srv, func(context.Context) error {
+		<-release
+
+		return nil
+	})
+
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitForReady(context.Background(), conn, 2*time.Second)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("WaitForReady returned before readiness completed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WaitForReady failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitForReady did not return after readiness completed")
+	}
+}
+
+func TestWaitForReadyTimesOut(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer lis.Close()
+
+	srv := grpc.NewServer()
+	registerHealth(srv, func(context.Context) error {
+		select {}
+	})
+
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := WaitForReady(context.Background(), conn, 50*time.Millisecond); err == nil {
+		t.Fatal("expected an error when readiness never completes before the timeout")
+	}
+}
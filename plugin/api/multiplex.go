@@ -0,0 +1,169 @@
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc/metadata"
+)
+
+// multiplexIDMetadataKey is the gRPC metadata key used to carry the
+// multiplex ID that selects which logical Embedding instance a call is
+// for, mirroring the MultiplexingSupport pattern used by Vault's
+// GRPCBackendPlugin.
+const multiplexIDMetadataKey = "lazygpt-multiplex-id"
+
+// EmbeddingFactory constructs a new Embedding instance for the given
+// multiplex ID. On success the result is cached and reused for the
+// lifetime of the plugin process; on failure the next call for the same
+// ID retries Factory rather than returning the same error forever.
+type EmbeddingFactory func(id string) (Embedding, error)
+
+// WithMultiplexID returns a context that, when used for an Embedding gRPC
+// call, routes the call to the multiplexed instance identified by id.
+func WithMultiplexID(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, multiplexIDMetadataKey, id)
+}
+
+// EmbeddingMultiplexGRPCServer is the gRPC server for a multiplexing
+// EmbeddingPlugin. It resolves each call's multiplex ID from incoming
+// metadata and routes it to the corresponding Embedding instance,
+// constructing instances on demand via Factory.
+type EmbeddingMultiplexGRPCServer struct {
+	UnimplementedEmbeddingServer
+
+	Factory EmbeddingFactory
+
+	// Broker, if set, is passed to every per-ID EmbeddingGRPCServer so
+	// plugin authors can dial back into the host regardless of which
+	// multiplexed instance handled the call.
+	Broker *plugin.GRPCBroker
+
+	mu      sync.Mutex
+	entries map[string]*multiplexEntry
+}
+
+// multiplexEntry lazily constructs the EmbeddingGRPCServer for one
+// multiplex ID. Its sync.Once ensures Factory runs at most once per entry
+// without holding EmbeddingMultiplexGRPCServer.mu for the duration of the
+// call, so a slow construction for one ID (e.g. a cold model load) can't
+// stall calls already routed to other, already-cached IDs. An entry whose
+// Factory call failed is evicted, so a later call for the ID retries.
+type multiplexEntry struct {
+	once sync.Once
+	srv  *EmbeddingGRPCServer
+	err  error
+}
+
+var _ EmbeddingServer = (*EmbeddingMultiplexGRPCServer)(nil)
+
+// NewEmbeddingMultiplexGRPCServer returns a new EmbeddingMultiplexGRPCServer.
+func NewEmbeddingMultiplexGRPCServer(factory EmbeddingFactory) *EmbeddingMultiplexGRPCServer {
+	return &EmbeddingMultiplexGRPCServer{
+		Factory: factory,
+		entries: make(map[string]*multiplexEntry),
+	}
+}
+
+// instance returns the EmbeddingGRPCServer for the multiplex ID carried in
+// ctx's incoming gRPC metadata, constructing it via Factory on first use.
+func (s *EmbeddingMultiplexGRPCServer) instance(ctx context.Context) (*EmbeddingGRPCServer, error) {
+	id, err := multiplexIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	if !ok {
+		entry = &multiplexEntry{}
+		s.entries[id] = entry
+	}
+	s.mu.Unlock()
+
+	entry.once.Do(func() {
+		impl, err := s.Factory(id)
+		if err != nil {
+			entry.err = fmt.Errorf("constructing embedding instance %q: %w", id, err)
+
+			return
+		}
+
+		srv := NewEmbeddingGRPCServer(impl)
+		srv.Broker = s.Broker
+		entry.srv = srv
+	})
+
+	if entry.err != nil {
+		// Don't let a transient Factory failure poison this ID for the
+		// rest of the process's lifetime: evict the failed entry so the
+		// next call gets a fresh multiplexEntry and retries Factory.
+		s.mu.Lock()
+		if s.entries[id] == entry {
+			delete(s.entries, id)
+		}
+		s.mu.Unlock()
+	}
+
+	return entry.srv, entry.err
+}
+
+func multiplexIDFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("multiplexed embedding call missing gRPC metadata")
+	}
+
+	ids := md.Get(multiplexIDMetadataKey)
+	if len(ids) == 0 || ids[0] == "" {
+		return "", fmt.Errorf("multiplexed embedding call missing %q metadata", multiplexIDMetadataKey)
+	}
+
+	return ids[0], nil
+}
+
+// Embedding implements EmbeddingServer by delegating to the instance
+// selected by the call's multiplex ID.
+func (s *EmbeddingMultiplexGRPCServer) Embedding(
+	ctx context.Context,
+	req *EmbeddingRequest,
+) (*EmbeddingResponse, error) {
+	srv, err := s.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return srv.Embedding(ctx, req)
+}
+
+// EmbeddingBatch implements EmbeddingServer by delegating to the instance
+// selected by the call's multiplex ID.
+func (s *EmbeddingMultiplexGRPCServer) EmbeddingBatch(
+	ctx context.Context,
+	req *EmbeddingBatchRequest,
+) (*EmbeddingBatchResponse, error) {
+	srv, err := s.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return srv.EmbeddingBatch(ctx, req)
+}
+
+// EmbeddingStream implements EmbeddingServer by delegating to the instance
+// selected by the call's multiplex ID.
+func (s *EmbeddingMultiplexGRPCServer) EmbeddingStream(
+	req *EmbeddingBatchRequest,
+	stream Embedding_EmbeddingStreamServer,
+) error {
+	srv, err := s.instance(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	return srv.EmbeddingStream(req, stream)
+}
@@ -0,0 +1,179 @@
+//
+
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMultiplexIDFromContext(t *testing.T) {
+	t.Run("missing metadata", func(t *testing.T) {
+		if _, err := multiplexIDFromContext(context.Background()); err == nil {
+			t.Fatal("expected error for missing gRPC metadata")
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+
+		if _, err := multiplexIDFromContext(ctx); err == nil {
+			t.Fatal("expected error for missing multiplex ID")
+		}
+	})
+
+	t.Run("present", func(t *testing.T) {
+		ctx := incomingContextWithMultiplexID("tenant-a")
+
+		id, err := multiplexIDFromContext(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if id != "tenant-a" {
+			t.Errorf("got id %q, want %q", id, "tenant-a")
+		}
+	})
+}
+
+type stubEmbedding struct{}
+
+func (stubEmbedding) Embedding(context.Context, string) ([]float32, error) {
+	return nil, nil
+}
+
+func TestEmbeddingMultiplexGRPCServerCachesInstances(t *testing.T) {
+	var calls int32
+
+	srv := NewEmbeddingMultiplexGRPCServer(func(string) (Embedding, error) {
+		atomic.AddInt32(&calls, 1)
+
+		return stubEmbedding{}, nil
+	})
+
+	ctx := incomingContextWithMultiplexID("tenant-a")
+
+	first, err := srv.instance(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := srv.instance(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first != second {
+		t.Error("expected the cached instance to be reused")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("factory called %d times, want 1", got)
+	}
+}
+
+func TestEmbeddingMultiplexGRPCServerPropagatesFactoryError(t *testing.T) {
+	wantErr := errors.New("boom")
+
+	srv := NewEmbeddingMultiplexGRPCServer(func(string) (Embedding, error) {
+		return nil, wantErr
+	})
+
+	_, err := srv.instance(incomingContextWithMultiplexID("tenant-a"))
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("got error %v, want it to wrap %v", err, wantErr)
+	}
+}
+
+func TestEmbeddingMultiplexGRPCServerRetriesAfterFactoryFailure(t *testing.T) {
+	wantErr := errors.New("transient")
+
+	var calls int32
+	srv := NewEmbeddingMultiplexGRPCServer(func(string) (Embedding, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, wantErr
+		}
+
+		return stubEmbedding{}, nil
+	})
+
+	ctx := incomingContextWithMultiplexID("tenant-a")
+
+	if _, err := srv.instance(ctx); !errors.Is(err, wantErr) {
+		t.Fatalf("first call: got error %v, want it to wrap %v", err, wantErr)
+	}
+
+	srv2, err := srv.instance(ctx)
+	if err != nil {
+		t.Fatalf("second call: unexpected error: %v", err)
+	}
+
+	if srv2 == nil {
+		t.Fatal("second call: expected a constructed instance after retrying Factory")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("factory called %d times, want 2 (one failure, one retry)", got)
+	}
+}
+
+func TestEmbeddingMultiplexGRPCServerDoesNotSerializeAcrossIDs(t *testing.T) {
+	slowStarted := make(chan struct{})
+	release := make(chan struct{})
+
+	srv := NewEmbeddingMultiplexGRPCServer(func(id string) (Embedding, error) {
+		if id == "slow" {
+			close(slowStarted)
+			<-release
+		}
+
+		return stubEmbedding{}, nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if _, err := srv.instance(incomingContextWithMultiplexID("slow")); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-slowStarted:
+	case <-time.After(time.Second):
+		t.Fatal("slow factory never started")
+	}
+
+	fastDone := make(chan struct{})
+	go func() {
+		if _, err := srv.instance(incomingContextWithMultiplexID("fast")); err != nil {
+			t.Error(err)
+		}
+
+		close(fastDone)
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Fatal("fast instance's construction blocked behind slow instance's construction")
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+func incomingContextWithMultiplexID(id string) context.Context {
+	outgoing := WithMultiplexID(context.Background(), id)
+	md, _ := metadata.FromOutgoingContext(outgoing)
+
+	return metadata.NewIncomingContext(context.Background(), md)
+}
@@ -0,0 +1,122 @@
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// Capability strings recognized for the Embedding plugin type. Plugin
+// authors report the subset they support in VersionInfo.Capabilities so
+// hosts can refuse to dispense a plugin that is missing what they need
+// instead of failing opaquely on first call.
+const (
+	CapabilityBatch     = "batch"
+	CapabilityStreaming = "streaming"
+)
+
+// VersionInfo describes a plugin's version and capabilities, returned in
+// response to a PluginVersion.Version call.
+type VersionInfo struct {
+	// Semver is the plugin's version, e.g. "1.4.0".
+	Semver string
+
+	// Capabilities lists the optional features this plugin instance
+	// supports, e.g. CapabilityBatch, CapabilityStreaming, or a
+	// dimensionality marker like "dim=1536".
+	Capabilities []string
+
+	// ModelMetadata carries free-form plugin/model details, e.g.
+	// {"model": "text-embedding-3-small"}.
+	ModelMetadata map[string]string
+}
+
+// VersionProvider returns the VersionInfo for a plugin. It should be
+// cheap and side-effect free; the host may call it before every
+// dispense.
+type VersionProvider func(ctx context.Context) (VersionInfo, error)
+
+// PluginVersionGRPCServer is the gRPC server for the PluginVersion
+// service, registered automatically by every plugin type in this
+// package.
+type PluginVersionGRPCServer struct {
+	UnimplementedPluginVersionServer
+
+	Provider VersionProvider
+}
+
+var _ PluginVersionServer = (*PluginVersionGRPCServer)(nil)
+
+// NewPluginVersionGRPCServer returns a new PluginVersionGRPCServer.
+func NewPluginVersionGRPCServer(provider VersionProvider) *PluginVersionGRPCServer {
+	return &PluginVersionGRPCServer{
+		Provider: provider,
+	}
+}
+
+// Version implements the gRPC server for the PluginVersion service.
+func (s *PluginVersionGRPCServer) Version(
+	ctx context.Context,
+	_ *VersionRequest,
+) (*VersionResponse, error) {
+	if s.Provider == nil {
+		return &VersionResponse{}, nil
+	}
+
+	info, err := s.Provider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("plugin version failed: %w", err)
+	}
+
+	return &VersionResponse{
+		Semver:        info.Semver,
+		Capabilities:  info.Capabilities,
+		ModelMetadata: info.ModelMetadata,
+	}, nil
+}
+
+// CheckCapabilities calls the PluginVersion service over conn and returns
+// an error naming any capability in required that the plugin did not
+// report. Hosts should call this right after handshake and refuse to
+// dispense the plugin on error.
+func CheckCapabilities(ctx context.Context, conn *grpc.ClientConn, required []string) (VersionInfo, error) {
+	client := NewPluginVersionClient(conn)
+
+	resp, err := client.Version(ctx, &VersionRequest{})
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("plugin version failed: %w", err)
+	}
+
+	info := VersionInfo{
+		Semver:        resp.Semver,
+		Capabilities:  resp.Capabilities,
+		ModelMetadata: resp.ModelMetadata,
+	}
+
+	if missing := missingCapabilities(info.Capabilities, required); len(missing) > 0 {
+		return info, fmt.Errorf("plugin missing required capabilities: %v", missing)
+	}
+
+	return info, nil
+}
+
+// missingCapabilities returns the entries of required that are not
+// present in have.
+func missingCapabilities(have, required []string) []string {
+	set := make(map[string]bool, len(have))
+	for _, capability := range have {
+		set[capability] = true
+	}
+
+	var missing []string
+	for _, capability := range required {
+		if !set[capability] {
+			missing = append(missing, capability)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,47 @@
+//
+
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		have     []string
+		required []string
+		want     []string
+	}{
+		{
+			name: "no requirements",
+			have: []string{"batch"},
+		},
+		{
+			name:     "all satisfied",
+			have:     []string{CapabilityBatch, CapabilityStreaming},
+			required: []string{CapabilityBatch},
+		},
+		{
+			name:     "missing one",
+			have:     []string{CapabilityBatch},
+			required: []string{CapabilityBatch, CapabilityStreaming},
+			want:     []string{CapabilityStreaming},
+		},
+		{
+			name:     "missing all",
+			required: []string{CapabilityBatch, CapabilityStreaming},
+			want:     []string{CapabilityBatch, CapabilityStreaming},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingCapabilities(tt.have, tt.required)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingCapabilities(%v, %v) = %v, want %v", tt.have, tt.required, got, tt.want)
+			}
+		})
+	}
+}